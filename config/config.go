@@ -0,0 +1,64 @@
+package config
+
+import "time"
+
+// P2PConfig defines the configuration options for the peer-to-peer layer.
+type P2PConfig struct {
+	ListenAddress       string `mapstructure:"laddr"`
+	ExternalAddress     string `mapstructure:"external-address"`
+	MaxNumInboundPeers  int    `mapstructure:"max-num-inbound-peers"`
+	MaxNumOutboundPeers int    `mapstructure:"max-num-outbound-peers"`
+}
+
+// DefaultP2PConfig returns a default configuration for the peer-to-peer layer.
+func DefaultP2PConfig() *P2PConfig {
+	return &P2PConfig{
+		ListenAddress:       "tcp://0.0.0.0:26656",
+		MaxNumInboundPeers:  40,
+		MaxNumOutboundPeers: 10,
+	}
+}
+
+// StateSyncConfig defines the configuration for the state sync reactor.
+type StateSyncConfig struct {
+	// Enable enables state sync.
+	Enable bool `mapstructure:"enable"`
+
+	// TempDir is the directory used to store in-progress snapshot chunks
+	// while they're being assembled.
+	TempDir string `mapstructure:"temp-dir"`
+
+	// ChunkDir, if set, persists verified chunks to disk as they're
+	// received so an interrupted sync can resume from where it left off
+	// instead of restarting from chunk 0. Leave empty to disable caching.
+	ChunkDir string `mapstructure:"chunk-dir"`
+
+	// MaxInflightChunks bounds how many chunk requests the scheduler keeps
+	// outstanding across all peers at once.
+	MaxInflightChunks int `mapstructure:"max-inflight-chunks"`
+
+	// ChunkRequestTimeout is how long the scheduler waits for a chunk
+	// response from a peer before re-requesting it from another peer.
+	ChunkRequestTimeout time.Duration `mapstructure:"chunk-request-timeout"`
+
+	// TrustedPeers lists node IDs that are trusted to single-handedly
+	// corroborate a candidate snapshot without waiting for quorum among
+	// other state-sync peers. Kept as node ID strings, rather than a p2p
+	// type, to avoid importing the p2p package here.
+	TrustedPeers []string `mapstructure:"trusted-peers"`
+
+	// ChunkCodecs lists the chunk compression codecs this node will accept
+	// from a provider (e.g. "zstd", "snappy"). Their order does not matter:
+	// the provider prefers zstd over snappy when both are accepted. Leave
+	// empty to only ever exchange raw, uncompressed chunks.
+	ChunkCodecs []string `mapstructure:"chunk-codecs"`
+}
+
+// DefaultStateSyncConfig returns a default configuration for the state sync
+// reactor.
+func DefaultStateSyncConfig() *StateSyncConfig {
+	return &StateSyncConfig{
+		MaxInflightChunks:   10,
+		ChunkRequestTimeout: 15 * time.Second,
+	}
+}
@@ -0,0 +1,116 @@
+package statesync
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Codec identifies how a chunk's bytes are encoded on the wire. It is
+// negotiated per request via ChunkRequest.AcceptedCodecs, so that large
+// chunks can travel compressed over ChunkChannel without requiring every
+// peer to support it.
+type Codec uint32
+
+const (
+	// CodecNone sends chunks as raw, uncompressed bytes. It is always
+	// supported, and is the fallback when peers don't advertise anything
+	// else in common.
+	CodecNone Codec = 0
+	// CodecSnappy compresses chunks with Snappy, favoring speed.
+	CodecSnappy Codec = 1
+	// CodecZstd compresses chunks with zstd, favoring ratio.
+	CodecZstd Codec = 2
+)
+
+// preferredCodecOrder lists codecs from most to least preferred when more
+// than one is accepted by both ends.
+var preferredCodecOrder = []Codec{CodecZstd, CodecSnappy}
+
+// codecNames maps the config.StateSyncConfig.ChunkCodecs names to their
+// wire Codec values. Unrecognized names are ignored rather than rejected,
+// so that a future codec can be added to the config docs without breaking
+// older binaries that don't know it yet.
+var codecNames = map[string]Codec{
+	"snappy": CodecSnappy,
+	"zstd":   CodecZstd,
+}
+
+// parseCodecs converts configured codec names into the Codec values to
+// advertise in ChunkRequest.AcceptedCodecs.
+func parseCodecs(names []string) []uint32 {
+	codecs := make([]uint32, 0, len(names))
+	for _, name := range names {
+		if codec, ok := codecNames[name]; ok {
+			codecs = append(codecs, uint32(codec))
+		}
+	}
+	return codecs
+}
+
+// negotiateCodec picks the most preferred codec present in accepted,
+// falling back to CodecNone if accepted is empty or names nothing this node
+// knows how to produce.
+func negotiateCodec(accepted []uint32) Codec {
+	offered := make(map[Codec]bool, len(accepted))
+	for _, c := range accepted {
+		offered[Codec(c)] = true
+	}
+
+	for _, codec := range preferredCodecOrder {
+		if offered[codec] {
+			return codec
+		}
+	}
+
+	return CodecNone
+}
+
+// compress encodes data with codec.
+func compress(codec Codec, data []byte) ([]byte, error) {
+	switch codec {
+	case CodecNone:
+		return data, nil
+	case CodecSnappy:
+		return snappy.Encode(nil, data), nil
+	case CodecZstd:
+		enc, err := zstd.NewWriter(nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create zstd encoder: %w", err)
+		}
+		defer enc.Close()
+		return enc.EncodeAll(data, nil), nil
+	default:
+		return nil, fmt.Errorf("unknown chunk codec %v", codec)
+	}
+}
+
+// decompress decodes data that was encoded with codec.
+func decompress(codec Codec, data []byte) ([]byte, error) {
+	switch codec {
+	case CodecNone:
+		return data, nil
+	case CodecSnappy:
+		out, err := snappy.Decode(nil, data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode snappy chunk: %w", err)
+		}
+		return out, nil
+	case CodecZstd:
+		dec, err := zstd.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create zstd decoder: %w", err)
+		}
+		defer dec.Close()
+		out, err := io.ReadAll(dec)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode zstd chunk: %w", err)
+		}
+		return out, nil
+	default:
+		return nil, fmt.Errorf("unknown chunk codec %v", codec)
+	}
+}
@@ -0,0 +1,106 @@
+package statesync
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNegotiateCodec(t *testing.T) {
+	testcases := map[string]struct {
+		accepted []uint32
+		expect   Codec
+	}{
+		"no codecs advertised falls back to raw":        {nil, CodecNone},
+		"unknown codec falls back to raw":               {[]uint32{99}, CodecNone},
+		"snappy only":                                   {[]uint32{uint32(CodecSnappy)}, CodecSnappy},
+		"zstd preferred over snappy when both offered":  {[]uint32{uint32(CodecSnappy), uint32(CodecZstd)}, CodecZstd},
+	}
+
+	for name, tc := range testcases {
+		t.Run(name, func(t *testing.T) {
+			require.Equal(t, tc.expect, negotiateCodec(tc.accepted))
+		})
+	}
+}
+
+func TestCompressDecompressRoundTrip(t *testing.T) {
+	data := bytes.Repeat([]byte("tendermint state sync chunk"), 1024)
+
+	for _, codec := range []Codec{CodecNone, CodecSnappy, CodecZstd} {
+		codec := codec
+		t.Run(codecName(codec), func(t *testing.T) {
+			compressed, err := compress(codec, data)
+			require.NoError(t, err)
+
+			decompressed, err := decompress(codec, compressed)
+			require.NoError(t, err)
+			require.Equal(t, data, decompressed)
+		})
+	}
+}
+
+func TestParseCodecs(t *testing.T) {
+	require.Equal(t, []uint32{uint32(CodecZstd), uint32(CodecSnappy)}, parseCodecs([]string{"zstd", "snappy"}))
+	require.Empty(t, parseCodecs([]string{"lz4"}))
+	require.Empty(t, parseCodecs(nil))
+}
+
+func codecName(codec Codec) string {
+	switch codec {
+	case CodecNone:
+		return "none"
+	case CodecSnappy:
+		return "snappy"
+	case CodecZstd:
+		return "zstd"
+	default:
+		return "unknown"
+	}
+}
+
+func randomChunk(size int) []byte {
+	r := rand.New(rand.NewSource(1))
+	data := make([]byte, size)
+	r.Read(data)
+	return data
+}
+
+func BenchmarkCompress(b *testing.B) {
+	chunk := randomChunk(16 << 20) // 16 MB, larger than a typical snapshot chunk of a few MB
+
+	for _, codec := range []Codec{CodecNone, CodecSnappy, CodecZstd} {
+		codec := codec
+		b.Run(codecName(codec), func(b *testing.B) {
+			b.SetBytes(int64(len(chunk)))
+			for i := 0; i < b.N; i++ {
+				if _, err := compress(codec, chunk); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkDecompress(b *testing.B) {
+	chunk := randomChunk(16 << 20)
+
+	for _, codec := range []Codec{CodecNone, CodecSnappy, CodecZstd} {
+		codec := codec
+		compressed, err := compress(codec, chunk)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		b.Run(codecName(codec), func(b *testing.B) {
+			b.SetBytes(int64(len(chunk)))
+			for i := 0; i < b.N; i++ {
+				if _, err := decompress(codec, compressed); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package statesync
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/tendermint/tendermint/crypto/merkle"
+	"github.com/tendermint/tendermint/crypto/tmhash"
+	cryptoproto "github.com/tendermint/tendermint/proto/tendermint/crypto"
+)
+
+// chunkManifest is the Merkle tree of a snapshot's chunk hashes, used to
+// produce and check per-chunk inclusion proofs against the snapshot's Hash.
+type chunkManifest struct {
+	snapshotHash []byte
+	proofs       []*merkle.Proof
+}
+
+// newChunkManifest builds a chunkManifest from the hash of every chunk in a
+// snapshot, in order, and checks that their Merkle root equals snapshotHash.
+func newChunkManifest(snapshotHash []byte, chunkHashes [][]byte) (*chunkManifest, error) {
+	if len(chunkHashes) == 0 {
+		return nil, errNoChunkHashes
+	}
+
+	root, proofs := merkle.ProofsFromByteSlices(chunkHashes)
+	if !bytes.Equal(root, snapshotHash) {
+		return nil, fmt.Errorf("chunk hashes do not match snapshot hash %X (got root %X)", snapshotHash, root)
+	}
+
+	return &chunkManifest{snapshotHash: snapshotHash, proofs: proofs}, nil
+}
+
+// proof returns the inclusion proof for the chunk at index.
+func (m *chunkManifest) proof(index uint32) (*cryptoproto.Proof, error) {
+	if int(index) >= len(m.proofs) {
+		return nil, fmt.Errorf("no proof for chunk index %v", index)
+	}
+
+	return m.proofs[index].ToProto(), nil
+}
+
+// VerifyChunk checks that chunk is the leaf at index in the Merkle tree
+// rooted at snapshotHash, given the inclusion proof returned alongside it in
+// a ChunkResponse. It lets a receiver validate a chunk as soon as it arrives,
+// instead of only checking the assembled snapshot's hash at the end.
+func VerifyChunk(snapshotHash []byte, index uint32, chunk []byte, proof *cryptoproto.Proof) error {
+	if proof == nil {
+		return fmt.Errorf("chunk %v has no proof", index)
+	}
+
+	p, err := merkle.ProofFromProto(proof)
+	if err != nil {
+		return fmt.Errorf("invalid proof for chunk %v: %w", index, err)
+	}
+
+	if p.Index != int64(index) {
+		return fmt.Errorf("proof is for chunk %v, expected %v", p.Index, index)
+	}
+
+	leaf := tmhash.Sum(chunk)
+
+	return p.Verify(snapshotHash, leaf)
+}
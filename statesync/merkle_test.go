@@ -0,0 +1,71 @@
+package statesync
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/tendermint/tendermint/crypto/merkle"
+	"github.com/tendermint/tendermint/crypto/tmhash"
+)
+
+func chunkHashesFor(chunks ...[]byte) [][]byte {
+	hashes := make([][]byte, len(chunks))
+	for i, chunk := range chunks {
+		hashes[i] = tmhash.Sum(chunk)
+	}
+	return hashes
+}
+
+func TestNewChunkManifest(t *testing.T) {
+	chunks := [][]byte{{1, 2, 3}, {4, 5, 6}, {7, 8, 9}}
+	hashes := chunkHashesFor(chunks...)
+	root, _ := merkle.ProofsFromByteSlices(hashes)
+
+	t.Run("valid hash", func(t *testing.T) {
+		manifest, err := newChunkManifest(root, hashes)
+		require.NoError(t, err)
+		require.Len(t, manifest.proofs, len(chunks))
+	})
+
+	t.Run("mismatched hash", func(t *testing.T) {
+		_, err := newChunkManifest([]byte("wrong"), hashes)
+		require.Error(t, err)
+	})
+
+	t.Run("no chunk hashes", func(t *testing.T) {
+		_, err := newChunkManifest(root, nil)
+		require.Equal(t, errNoChunkHashes, err)
+	})
+}
+
+func TestVerifyChunk(t *testing.T) {
+	chunks := [][]byte{{1, 2, 3}, {4, 5, 6}, {7, 8, 9}}
+	hashes := chunkHashesFor(chunks...)
+	root, _ := merkle.ProofsFromByteSlices(hashes)
+
+	manifest, err := newChunkManifest(root, hashes)
+	require.NoError(t, err)
+
+	for i, chunk := range chunks {
+		proof, err := manifest.proof(uint32(i))
+		require.NoError(t, err)
+		require.NoError(t, VerifyChunk(root, uint32(i), chunk, proof))
+	}
+
+	t.Run("tampered chunk", func(t *testing.T) {
+		proof, err := manifest.proof(0)
+		require.NoError(t, err)
+		require.Error(t, VerifyChunk(root, 0, []byte{9, 9, 9}, proof))
+	})
+
+	t.Run("wrong index", func(t *testing.T) {
+		proof, err := manifest.proof(1)
+		require.NoError(t, err)
+		require.Error(t, VerifyChunk(root, 0, chunks[1], proof))
+	})
+
+	t.Run("missing proof", func(t *testing.T) {
+		require.Error(t, VerifyChunk(root, 0, chunks[0], nil))
+	})
+}
@@ -0,0 +1,68 @@
+package statesync
+
+import (
+	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/kit/metrics/discard"
+	prometheus "github.com/go-kit/kit/metrics/prometheus"
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
+)
+
+// MetricsSubsystem is a subsystem shared by all metrics exposed by this
+// package.
+const MetricsSubsystem = "statesync"
+
+// Metrics contains the metrics exposed by the state sync reactor's chunk
+// scheduler.
+type Metrics struct {
+	// ChunksPerSecond tracks the rate at which chunks are being verified and
+	// applied during a sync.
+	ChunksPerSecond metrics.Gauge
+
+	// ChunkRetries counts chunk requests that had to be re-sent after a
+	// timeout or an invalid response. The retry goes to the best-scoring
+	// peer, which can be the same peer as before.
+	ChunkRetries metrics.Counter
+
+	// PeerScore tracks the scheduler's current score for each peer,
+	// labeled by peer_id.
+	PeerScore metrics.Gauge
+}
+
+// PrometheusMetrics returns Metrics built using Prometheus client, and
+// registers it under the given namespace.
+func PrometheusMetrics(namespace string, labelsAndValues ...string) *Metrics {
+	labels := []string{}
+	for i := 0; i < len(labelsAndValues); i += 2 {
+		labels = append(labels, labelsAndValues[i])
+	}
+
+	return &Metrics{
+		ChunksPerSecond: prometheus.NewGaugeFrom(stdprometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: MetricsSubsystem,
+			Name:      "chunks_per_second",
+			Help:      "Rate of verified state sync chunks per second.",
+		}, labels).With(labelsAndValues...),
+		ChunkRetries: prometheus.NewCounterFrom(stdprometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: MetricsSubsystem,
+			Name:      "chunk_retries_total",
+			Help:      "Number of chunk requests re-sent after a timeout or failed response.",
+		}, labels).With(labelsAndValues...),
+		PeerScore: prometheus.NewGaugeFrom(stdprometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: MetricsSubsystem,
+			Name:      "peer_score",
+			Help:      "Current scheduler score for a state sync peer.",
+		}, append(labels, "peer_id")).With(labelsAndValues...),
+	}
+}
+
+// NopMetrics returns no-op Metrics.
+func NopMetrics() *Metrics {
+	return &Metrics{
+		ChunksPerSecond: discard.NewGauge(),
+		ChunkRetries:    discard.NewCounter(),
+		PeerScore:       discard.NewGauge(),
+	}
+}
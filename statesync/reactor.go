@@ -0,0 +1,478 @@
+package statesync
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+
+	abci "github.com/tendermint/tendermint/abci/types"
+	"github.com/tendermint/tendermint/config"
+	"github.com/tendermint/tendermint/libs/log"
+	"github.com/tendermint/tendermint/p2p"
+	"github.com/tendermint/tendermint/proxy"
+
+	ssproto "github.com/tendermint/tendermint/proto/tendermint/statesync"
+)
+
+const (
+	// SnapshotChannel exchanges snapshot offers and lists.
+	SnapshotChannel = byte(0x60)
+	// ChunkChannel exchanges chunk contents.
+	ChunkChannel = byte(0x61)
+)
+
+// Reactor handles state sync, both restoring snapshots for the local node and
+// serving snapshots for other nodes.
+type Reactor struct {
+	logger log.Logger
+
+	sw          *p2p.Switch
+	conn        proxy.AppConnSnapshot
+	connQuery   proxy.AppConnQuery
+	snapshotCh  *p2p.Channel
+	chunkCh     *p2p.Channel
+	peerUpdates *p2p.PeerUpdateCh
+	tempDir     string
+	cfg         *config.StateSyncConfig
+	metrics     *Metrics
+
+	// manifests holds, per (height, format), the per-chunk hashes of a
+	// snapshot this node is serving, used to attach Merkle inclusion proofs
+	// to ChunkResponses. It is populated by LoadManifest and left empty by
+	// default so that providers which haven't opted in simply serve chunks
+	// without a proof, as before.
+	manifests map[manifestKey]*chunkManifest
+
+	// syncingManifest, if set, is the manifest of the snapshot this node is
+	// currently restoring from peers, used to verify inbound chunks as they
+	// arrive.
+	syncingManifest *chunkManifest
+
+	// scheduler fans chunk requests for the snapshot currently being
+	// restored out across peers; it is nil until Sync is called.
+	scheduler *scheduler
+
+	// store persists verified chunks to disk so a sync can resume after a
+	// restart; it is nil unless cfg.ChunkDir is set.
+	store *chunkStore
+
+	// connectedPeers tracks currently connected peers so the trust tracker
+	// can size its quorum requirement. Only ever touched from Run's
+	// goroutine.
+	connectedPeers map[p2p.PeerID]bool
+
+	// trust corroborates snapshots advertised by peers before they're
+	// offered to onSnapshotTrusted.
+	trust *trustTracker
+
+	// onSnapshotTrusted, if set, is called once a candidate snapshot has
+	// been corroborated by quorum or a trusted anchor, so that the node can
+	// offer it to the ABCI app.
+	onSnapshotTrusted func(resp *ssproto.SnapshotsResponse)
+
+	// onApplyFailed, if set, is called when the ABCI app reports that the
+	// snapshot currently being restored can't be applied at all (as opposed
+	// to just one bad chunk), so the caller can discard it and try a
+	// different snapshot candidate.
+	onApplyFailed func(height uint64, format uint32, result abci.ResponseApplySnapshotChunk_Result)
+}
+
+type manifestKey struct {
+	height uint64
+	format uint32
+}
+
+// NewReactor creates a new state sync reactor.
+func NewReactor(
+	logger log.Logger,
+	sw *p2p.Switch,
+	conn proxy.AppConnSnapshot,
+	connQuery proxy.AppConnQuery,
+	snapshotCh *p2p.Channel,
+	chunkCh *p2p.Channel,
+	peerUpdates *p2p.PeerUpdateCh,
+	tempDir string,
+	cfg *config.StateSyncConfig,
+	metrics *Metrics,
+) *Reactor {
+	if cfg == nil {
+		cfg = config.DefaultStateSyncConfig()
+	}
+	if metrics == nil {
+		metrics = NopMetrics()
+	}
+
+	var store *chunkStore
+	if cfg.ChunkDir != "" {
+		var err error
+		store, err = newChunkStore(cfg.ChunkDir)
+		if err != nil {
+			logger.Error("failed to open chunk cache, syncs will not be resumable", "dir", cfg.ChunkDir, "err", err)
+		}
+	}
+
+	return &Reactor{
+		logger:         logger,
+		sw:             sw,
+		conn:           conn,
+		connQuery:      connQuery,
+		snapshotCh:     snapshotCh,
+		chunkCh:        chunkCh,
+		peerUpdates:    peerUpdates,
+		tempDir:        tempDir,
+		cfg:            cfg,
+		metrics:        metrics,
+		manifests:      make(map[manifestKey]*chunkManifest),
+		store:          store,
+		connectedPeers: make(map[p2p.PeerID]bool),
+	}
+}
+
+// SetAppHashVerifier wires a light client into the reactor's trust tracker,
+// so candidate snapshots whose hash disagrees with a verified AppHash at
+// that height are rejected regardless of peer quorum. It must be called
+// before Run.
+func (r *Reactor) SetAppHashVerifier(verifier AppHashVerifier) {
+	trustedPeers := make([]p2p.ID, len(r.cfg.TrustedPeers))
+	for i, id := range r.cfg.TrustedPeers {
+		trustedPeers[i] = p2p.ID(id)
+	}
+
+	r.trust = newTrustTracker(trustedPeers, verifier, func() int { return len(r.connectedPeers) })
+}
+
+// OnSnapshotTrusted registers a callback invoked once a candidate snapshot
+// has been corroborated by quorum or a trusted anchor peer.
+func (r *Reactor) OnSnapshotTrusted(fn func(resp *ssproto.SnapshotsResponse)) {
+	r.onSnapshotTrusted = fn
+}
+
+// OnApplyFailed registers a callback invoked when the ABCI app rejects the
+// snapshot currently being restored outright, rather than just one chunk.
+func (r *Reactor) OnApplyFailed(fn func(height uint64, format uint32, result abci.ResponseApplySnapshotChunk_Result)) {
+	r.onApplyFailed = fn
+}
+
+// Sync starts restoring the given snapshot, fanning ChunkRequests out across
+// every peer currently known to the reactor and rebalancing outstanding
+// requests onto faster peers as chunks come in or peers time out. If a chunk
+// cache is configured, chunks already cached from a prior, interrupted sync
+// of this snapshot are reused instead of re-requested, and any cache left
+// over from a different, now-superseded snapshot is discarded.
+func (r *Reactor) Sync(height uint64, format uint32, total uint32, snapshotHash []byte) {
+	r.syncingManifest = nil
+	if manifest, ok := r.manifests[manifestKey{height, format}]; ok && bytes.Equal(manifest.snapshotHash, snapshotHash) {
+		r.syncingManifest = manifest
+	}
+
+	var cached []uint32
+	if r.store != nil {
+		key := manifestKey{height, format}
+
+		if err := r.store.PruneStale(key); err != nil {
+			r.logger.Error("failed to prune stale chunk caches", "err", err)
+		}
+
+		var err error
+		cached, err = r.store.CachedIndexes(height, format)
+		if err != nil {
+			r.logger.Error("failed to read cached chunks, resuming from scratch", "height", height, "format", format, "err", err)
+			cached = nil
+		}
+
+		if r.syncingManifest == nil {
+			if stored, ok, err := r.store.LoadManifest(height, format); err != nil {
+				r.logger.Error("failed to read cached chunk manifest", "height", height, "format", format, "err", err)
+			} else if ok {
+				if manifest, err := newChunkManifest(stored.SnapshotHash, stored.ChunkHashes); err == nil {
+					r.manifests[key] = manifest
+					r.syncingManifest = manifest
+				}
+			}
+		}
+
+		if len(cached) > 0 {
+			r.logger.Info("resuming state sync from cached chunks", "height", height, "format", format, "cached", len(cached), "total", total)
+		}
+	}
+
+	// A richer manifest (with per-chunk hashes, letting us also serve this
+	// snapshot) may already be cached above, but every restoring node must
+	// be able to check chunk proofs regardless, so fall back to a minimal
+	// verifier built directly from the snapshot's root hash.
+	if r.syncingManifest == nil && len(snapshotHash) > 0 {
+		r.syncingManifest = &chunkManifest{snapshotHash: snapshotHash}
+	}
+
+	r.scheduler = newScheduler(r.logger, r.cfg, r.metrics, func(peer p2p.PeerID, req *ssproto.ChunkRequest) {
+		r.chunkCh.Out <- p2p.Envelope{To: peer, Message: req}
+	})
+	for peer := range r.connectedPeers {
+		r.scheduler.addPeer(peer)
+	}
+	r.scheduler.start(height, format, total, cached...)
+}
+
+// LoadManifest registers the per-chunk hashes for a snapshot this node is
+// serving, so that subsequent ChunkResponses for it carry a Merkle inclusion
+// proof against snapshotHash. chunkHashes[i] must be the hash of chunk i, and
+// their Merkle root must equal snapshotHash.
+func (r *Reactor) LoadManifest(height uint64, format uint32, snapshotHash []byte, chunkHashes [][]byte) error {
+	manifest, err := newChunkManifest(snapshotHash, chunkHashes)
+	if err != nil {
+		return err
+	}
+
+	r.manifests[manifestKey{height, format}] = manifest
+
+	if r.store != nil {
+		if err := r.store.SaveManifest(height, format, snapshotHash, chunkHashes); err != nil {
+			return fmt.Errorf("failed to cache chunk manifest: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// Run processes inbound envelopes on the snapshot and chunk channels until
+// ctx is canceled.
+func (r *Reactor) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case envelope := <-r.snapshotCh.In:
+			r.handleSnapshotEnvelope(envelope)
+		case envelope := <-r.chunkCh.In:
+			r.handleChunkEnvelope(envelope)
+		case update := <-r.peerUpdates.Updates():
+			r.handlePeerUpdate(update)
+		}
+	}
+}
+
+func (r *Reactor) handlePeerUpdate(update p2p.PeerUpdate) {
+	switch update.Status {
+	case p2p.PeerStatusUp:
+		r.connectedPeers[update.PeerID] = true
+	case p2p.PeerStatusDown:
+		delete(r.connectedPeers, update.PeerID)
+	}
+
+	if r.scheduler == nil {
+		return
+	}
+
+	switch update.Status {
+	case p2p.PeerStatusUp:
+		r.scheduler.addPeer(update.PeerID)
+	case p2p.PeerStatusDown:
+		r.scheduler.removePeer(update.PeerID)
+	}
+}
+
+func (r *Reactor) handleSnapshotEnvelope(envelope p2p.Envelope) {
+	switch msg := envelope.Message.(type) {
+	case *ssproto.SnapshotsRequest:
+		r.handleSnapshotsRequest(envelope.From)
+	case *ssproto.SnapshotsResponse:
+		r.handleSnapshotsResponse(envelope.From, msg)
+	default:
+		r.logger.Error("received unknown message on snapshot channel", "message", msg)
+	}
+}
+
+// handleSnapshotsResponse corroborates a candidate snapshot advertised by a
+// peer, and, once trusted, offers it to the ABCI app via
+// onSnapshotTrusted. If no trust tracker has been configured (via
+// SetAppHashVerifier), every candidate is offered immediately, preserving
+// the reactor's pre-trust-layer behavior.
+func (r *Reactor) handleSnapshotsResponse(peer p2p.PeerID, resp *ssproto.SnapshotsResponse) {
+	if r.trust == nil {
+		if r.onSnapshotTrusted != nil {
+			r.onSnapshotTrusted(resp)
+		}
+		return
+	}
+
+	trusted, err := r.trust.Offer(peer, resp.Height, resp.Format, resp.Hash)
+	if err != nil {
+		r.logger.Error("rejecting snapshot offer", "peer", peer, "height", resp.Height, "format", resp.Format, "err", err)
+		r.snapshotCh.Error <- p2p.PeerError{PeerID: peer, Err: err}
+		return
+	}
+
+	if trusted && r.onSnapshotTrusted != nil {
+		r.onSnapshotTrusted(resp)
+	}
+}
+
+func (r *Reactor) handleSnapshotsRequest(peer p2p.PeerID) {
+	resp, err := r.conn.ListSnapshotsSync(abci.RequestListSnapshots{})
+	if err != nil {
+		r.logger.Error("failed to list snapshots", "err", err)
+		return
+	}
+
+	for _, snapshot := range resp.Snapshots {
+		r.snapshotCh.Out <- p2p.Envelope{
+			To: peer,
+			Message: &ssproto.SnapshotsResponse{
+				Height:   snapshot.Height,
+				Format:   snapshot.Format,
+				Chunks:   snapshot.Chunks,
+				Hash:     snapshot.Hash,
+				Metadata: snapshot.Metadata,
+			},
+		}
+	}
+}
+
+func (r *Reactor) handleChunkEnvelope(envelope p2p.Envelope) {
+	switch msg := envelope.Message.(type) {
+	case *ssproto.ChunkRequest:
+		r.handleChunkRequest(envelope.From, msg)
+	case *ssproto.ChunkResponse:
+		r.handleChunkResponse(envelope.From, msg)
+	default:
+		r.logger.Error("received unknown message on chunk channel", "message", msg)
+	}
+}
+
+func (r *Reactor) handleChunkRequest(peer p2p.PeerID, req *ssproto.ChunkRequest) {
+	resp, err := r.conn.LoadSnapshotChunkSync(abci.RequestLoadSnapshotChunk{
+		Height: req.Height,
+		Format: req.Format,
+		Chunk:  req.Index,
+	})
+	if err != nil {
+		r.logger.Error("failed to load chunk", "height", req.Height, "format", req.Format, "index", req.Index, "err", err)
+		return
+	}
+
+	msg := &ssproto.ChunkResponse{
+		Height: req.Height,
+		Format: req.Format,
+		Index:  req.Index,
+	}
+
+	switch {
+	case resp.Chunk == nil:
+		msg.Missing = true
+	case len(resp.Chunk) == 0:
+		msg.Chunk = nil
+	default:
+		msg.Chunk = resp.Chunk
+		if manifest, ok := r.manifests[manifestKey{req.Height, req.Format}]; ok {
+			proof, err := manifest.proof(req.Index)
+			if err != nil {
+				r.logger.Error("failed to build chunk proof", "height", req.Height, "format", req.Format, "index", req.Index, "err", err)
+			} else {
+				msg.Proof = proof
+			}
+		}
+
+		// The proof above is always over the raw chunk, so compression is
+		// applied last: negotiate the best codec both ends advertise
+		// support for, falling back to raw bytes if there's no overlap.
+		codec := negotiateCodec(req.AcceptedCodecs)
+		if compressed, err := compress(codec, msg.Chunk); err != nil {
+			r.logger.Error("failed to compress chunk, sending raw", "height", req.Height, "format", req.Format, "index", req.Index, "err", err)
+		} else {
+			msg.Chunk = compressed
+			msg.Codec = uint32(codec)
+		}
+	}
+
+	r.chunkCh.Out <- p2p.Envelope{To: peer, Message: msg}
+}
+
+func (r *Reactor) handleChunkResponse(peer p2p.PeerID, resp *ssproto.ChunkResponse) {
+	if resp.Missing {
+		if r.scheduler != nil {
+			r.scheduler.onError(peer, resp.Index)
+		}
+		return
+	}
+
+	// Drop anything we didn't actually ask this peer for before doing any
+	// other work on it: an unsolicited or mismatched (height, format, index)
+	// is either a stale response for a sync we've since moved on from, or a
+	// peer trying to get arbitrary bytes verified and cached to disk.
+	if r.scheduler == nil || !r.scheduler.matchesPending(peer, resp.Height, resp.Format, resp.Index) {
+		r.logger.Debug("dropping unsolicited chunk response", "peer", peer, "height", resp.Height, "format", resp.Format, "index", resp.Index)
+		return
+	}
+
+	wireSize := len(resp.Chunk)
+
+	chunk, err := decompress(Codec(resp.Codec), resp.Chunk)
+	if err != nil {
+		r.logger.Error("rejecting chunk with unreadable codec", "peer", peer, "codec", resp.Codec, "index", resp.Index, "err", err)
+		r.chunkCh.Error <- p2p.PeerError{PeerID: peer, Err: fmt.Errorf("undecodable chunk %v: %w", resp.Index, err)}
+		r.scheduler.onError(peer, resp.Index)
+		return
+	}
+	resp.Chunk = chunk
+
+	// Every restoring node must check chunk proofs, so syncingManifest is
+	// always set by Sync once a snapshot hash is known; verification is
+	// unconditional on resp.Proof so a peer can't dodge it by omitting the
+	// proof rather than forging one — VerifyChunk treats a nil proof as a
+	// verification failure, same as a mismatched one.
+	if r.syncingManifest != nil {
+		if err := VerifyChunk(r.syncingManifest.snapshotHash, resp.Index, resp.Chunk, resp.Proof); err != nil {
+			r.logger.Error("rejecting chunk with invalid proof", "peer", peer, "height", resp.Height, "format", resp.Format, "index", resp.Index, "err", err)
+			r.chunkCh.Error <- p2p.PeerError{
+				PeerID: peer,
+				Err:    fmt.Errorf("invalid chunk proof for chunk %v: %w", resp.Index, err),
+			}
+			r.scheduler.onError(peer, resp.Index)
+			return
+		}
+	}
+
+	applyResp, err := r.conn.ApplySnapshotChunkSync(abci.RequestApplySnapshotChunk{
+		Index:  resp.Index,
+		Chunk:  resp.Chunk,
+		Sender: string(peer),
+	})
+	if err != nil {
+		r.logger.Error("failed to apply chunk", "height", resp.Height, "format", resp.Format, "index", resp.Index, "err", err)
+		r.scheduler.onError(peer, resp.Index)
+		return
+	}
+
+	for _, sender := range applyResp.RejectSenders {
+		r.scheduler.removePeer(p2p.PeerID(sender))
+	}
+
+	switch applyResp.Result {
+	case abci.ResponseApplySnapshotChunk_ACCEPT:
+		// handled below: cached and scored like any other completed chunk.
+	case abci.ResponseApplySnapshotChunk_RETRY:
+		r.logger.Error("app asked to retry chunk", "height", resp.Height, "format", resp.Format, "index", resp.Index)
+		r.scheduler.onError(peer, resp.Index)
+		return
+	default:
+		// ABORT, REJECT_SNAPSHOT and RETRY_SNAPSHOT all mean this snapshot,
+		// not just this chunk, can no longer be applied.
+		r.logger.Error("app rejected snapshot, aborting sync", "height", resp.Height, "format", resp.Format, "index", resp.Index, "result", applyResp.Result)
+		r.scheduler.abort()
+		if r.onApplyFailed != nil {
+			r.onApplyFailed(resp.Height, resp.Format, applyResp.Result)
+		}
+		return
+	}
+
+	if r.store != nil {
+		if err := r.store.SaveChunk(resp.Height, resp.Format, resp.Index, resp.Chunk); err != nil {
+			r.logger.Error("failed to cache chunk to disk", "height", resp.Height, "format", resp.Format, "index", resp.Index, "err", err)
+		}
+	}
+
+	r.scheduler.onResponse(peer, resp.Index, wireSize)
+}
+
+var errNoChunkHashes = errors.New("no chunk hashes given")
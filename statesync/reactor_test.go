@@ -84,6 +84,8 @@ func TestReactor_Receive_ChunkRequest(t *testing.T) {
 				shim.GetChannel(p2p.ChannelID(ChunkChannel)),
 				shim.PeerUpdateCh,
 				"",
+				config.DefaultStateSyncConfig(),
+				NopMetrics(),
 			)
 
 			ctx, cancel := context.WithCancel(context.Background())
@@ -189,6 +191,8 @@ func TestReactor_Receive_SnapshotsRequest(t *testing.T) {
 				shim.GetChannel(p2p.ChannelID(ChunkChannel)),
 				shim.PeerUpdateCh,
 				"",
+				config.DefaultStateSyncConfig(),
+				NopMetrics(),
 			)
 
 			ctx, cancel := context.WithCancel(context.Background())
@@ -0,0 +1,390 @@
+package statesync
+
+import (
+	"sync"
+	"time"
+
+	"github.com/tendermint/tendermint/config"
+	"github.com/tendermint/tendermint/libs/log"
+	"github.com/tendermint/tendermint/p2p"
+	ssproto "github.com/tendermint/tendermint/proto/tendermint/statesync"
+)
+
+// scoreAlpha is the smoothing factor for the peer score EWMA: higher values
+// react faster to a peer's most recent chunk, lower values smooth out noise.
+const scoreAlpha = 0.3
+
+// initialPeerScore is the score assigned to a peer before it has completed
+// any chunk requests, chosen so that untested peers are tried before
+// obviously bad ones but don't crowd out peers with a proven track record.
+const initialPeerScore = 1.0
+
+// chunksPerSecondAlpha is the smoothing factor for the chunks/sec EWMA,
+// folded in the same way as scoreAlpha.
+const chunksPerSecondAlpha = 0.3
+
+// scheduler fans chunk requests for a single snapshot out across every peer
+// known to have it, tracks an exponentially-weighted score for each peer's
+// latency, throughput and error rate, and on timeout lowers that peer's score
+// and re-requests the chunk from the best-scoring peer with spare capacity.
+// The retry can go to the same peer if it still scores highest.
+type scheduler struct {
+	logger  log.Logger
+	cfg     *config.StateSyncConfig
+	metrics *Metrics
+
+	// send dispatches a ChunkRequest to a peer; it is a function so the
+	// scheduler can be tested without a real p2p.Channel.
+	send func(peer p2p.PeerID, req *ssproto.ChunkRequest)
+
+	// acceptedCodecs is advertised on every ChunkRequest so a provider
+	// knows which chunk compression codecs this node can decode.
+	acceptedCodecs []uint32
+
+	mtx     sync.Mutex
+	height  uint64
+	format  uint32
+	peers   map[p2p.PeerID]*peerStats
+	pending map[uint32]*inflightRequest
+	queue   []uint32
+	done    map[uint32]bool
+
+	// chunksPerSecond is an EWMA of the rate at which chunks are completing,
+	// reported via Metrics.ChunksPerSecond.
+	chunksPerSecond float64
+
+	// lastCompletedAt is when the previous chunk completed, so that the
+	// chunk rate is measured between completions rather than per request.
+	lastCompletedAt time.Time
+}
+
+type peerStats struct {
+	score    float64
+	inflight int
+}
+
+type inflightRequest struct {
+	peer   p2p.PeerID
+	sentAt time.Time
+	timer  *time.Timer
+}
+
+func newScheduler(
+	logger log.Logger,
+	cfg *config.StateSyncConfig,
+	metrics *Metrics,
+	send func(peer p2p.PeerID, req *ssproto.ChunkRequest),
+) *scheduler {
+	return &scheduler{
+		logger:         logger,
+		cfg:            cfg,
+		metrics:        metrics,
+		send:           send,
+		acceptedCodecs: parseCodecs(cfg.ChunkCodecs),
+		peers:          make(map[p2p.PeerID]*peerStats),
+		pending:        make(map[uint32]*inflightRequest),
+		done:           make(map[uint32]bool),
+	}
+}
+
+// addPeer registers a peer as a candidate to fetch chunks from.
+func (s *scheduler) addPeer(peer p2p.PeerID) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if _, ok := s.peers[peer]; !ok {
+		s.peers[peer] = &peerStats{score: initialPeerScore}
+	}
+}
+
+// removePeer drops a peer, re-queueing any chunk it still owed us.
+func (s *scheduler) removePeer(peer p2p.PeerID) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	delete(s.peers, peer)
+
+	for index, req := range s.pending {
+		if req.peer == peer {
+			s.requeueLocked(index)
+		}
+	}
+
+	s.dispatchLocked()
+}
+
+// start begins fetching the given snapshot's chunks, fanning requests out
+// across every currently known peer up to cfg.MaxInflightChunks at a time.
+// Indexes in alreadyDone (e.g. recovered from an on-disk chunk cache) are
+// skipped rather than re-requested.
+func (s *scheduler) start(height uint64, format uint32, total uint32, alreadyDone ...uint32) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	done := make(map[uint32]bool, len(alreadyDone))
+	for _, index := range alreadyDone {
+		done[index] = true
+	}
+
+	s.height = height
+	s.format = format
+	s.pending = make(map[uint32]*inflightRequest)
+	s.done = done
+
+	s.queue = s.queue[:0]
+	for i := uint32(0); i < total; i++ {
+		if !done[i] {
+			s.queue = append(s.queue, i)
+		}
+	}
+
+	s.dispatchLocked()
+}
+
+// dispatchLocked assigns queued chunk indices to the best-scoring peers with
+// spare capacity, until either the queue or the inflight budget is
+// exhausted. Callers must hold s.mtx.
+func (s *scheduler) dispatchLocked() {
+	maxInflight := s.cfg.MaxInflightChunks
+	if maxInflight <= 0 {
+		maxInflight = 1
+	}
+
+	// A peer's fair share of maxInflight, so that cfg.MaxInflightChunks is
+	// reachable even with fewer connected peers than the configured limit: a
+	// fast peer can be given several outstanding chunks at once instead of
+	// concurrency being capped at the number of connected peers.
+	maxPerPeer := maxInflight
+	if n := len(s.peers); n > 0 {
+		if perPeer := (maxInflight + n - 1) / n; perPeer > 0 {
+			maxPerPeer = perPeer
+		}
+	}
+
+	for len(s.queue) > 0 && len(s.pending) < maxInflight {
+		peer, ok := s.bestAvailablePeerLocked(maxPerPeer)
+		if !ok {
+			return
+		}
+
+		index := s.queue[0]
+		s.queue = s.queue[1:]
+
+		s.sendLocked(peer, index)
+	}
+}
+
+// bestAvailablePeerLocked returns the highest-scoring peer with fewer than
+// maxPerPeer chunks already in flight.
+func (s *scheduler) bestAvailablePeerLocked(maxPerPeer int) (p2p.PeerID, bool) {
+	var (
+		best      p2p.PeerID
+		bestScore = -1.0
+		found     bool
+	)
+
+	for peer, stats := range s.peers {
+		if stats.inflight >= maxPerPeer {
+			continue
+		}
+		if !found || stats.score > bestScore {
+			best, bestScore, found = peer, stats.score, true
+		}
+	}
+
+	return best, found
+}
+
+func (s *scheduler) sendLocked(peer p2p.PeerID, index uint32) {
+	timeout := s.cfg.ChunkRequestTimeout
+	if timeout <= 0 {
+		timeout = 15 * time.Second
+	}
+
+	s.peers[peer].inflight++
+	req := &inflightRequest{peer: peer, sentAt: time.Now()}
+	req.timer = time.AfterFunc(timeout, func() { s.onTimeout(peer, index) })
+	s.pending[index] = req
+
+	s.send(peer, &ssproto.ChunkRequest{
+		Height:         s.height,
+		Format:         s.format,
+		Index:          index,
+		AcceptedCodecs: s.acceptedCodecs,
+	})
+}
+
+// matchesPending reports whether (height, format, index) is a chunk the
+// scheduler actually asked peer for and is still waiting on. Callers should
+// drop anything this returns false for, rather than acting on an unsolicited
+// response a peer could otherwise use to get arbitrary bytes cached to disk.
+func (s *scheduler) matchesPending(peer p2p.PeerID, height uint64, format uint32, index uint32) bool {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if height != s.height || format != s.format {
+		return false
+	}
+
+	req, ok := s.pending[index]
+	return ok && req.peer == peer
+}
+
+// onResponse records a successfully received and verified chunk, updating
+// the sending peer's score from the observed latency and chunk size.
+func (s *scheduler) onResponse(peer p2p.PeerID, index uint32, chunkSize int) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	req, ok := s.pending[index]
+	if !ok || req.peer != peer {
+		return
+	}
+
+	req.timer.Stop()
+	delete(s.pending, index)
+	s.done[index] = true
+
+	latency := time.Since(req.sentAt)
+	s.scoreLocked(peer, throughputSample(chunkSize, latency))
+	s.recordChunkRateLocked(latency)
+
+	if stats, ok := s.peers[peer]; ok && stats.inflight > 0 {
+		stats.inflight--
+	}
+
+	s.reportScoresLocked()
+	s.dispatchLocked()
+}
+
+// onError records a chunk request that came back missing or failed
+// verification, penalizing the peer and re-queueing the chunk.
+func (s *scheduler) onError(peer p2p.PeerID, index uint32) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	req, ok := s.pending[index]
+	if !ok || req.peer != peer {
+		return
+	}
+
+	s.scoreLocked(peer, 0)
+	s.requeueLocked(index)
+	s.metrics.ChunkRetries.Add(1)
+	s.reportScoresLocked()
+	s.dispatchLocked()
+}
+
+// onTimeout fires when a peer hasn't answered a chunk request within
+// cfg.ChunkRequestTimeout; it scores the peer as if it had errored and
+// re-requests the chunk from whichever peer now looks best.
+func (s *scheduler) onTimeout(peer p2p.PeerID, index uint32) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	req, ok := s.pending[index]
+	if !ok || req.peer != peer {
+		return
+	}
+
+	s.logger.Debug("chunk request timed out, rescheduling", "peer", peer, "index", index)
+
+	s.scoreLocked(peer, 0)
+	s.requeueLocked(index)
+	s.metrics.ChunkRetries.Add(1)
+	s.reportScoresLocked()
+	s.dispatchLocked()
+}
+
+// requeueLocked stops index's inflight timer (if any), puts it back at the
+// front of the queue, and clears its inflight bookkeeping. Called both when
+// a request has failed outright (onError, onTimeout) and when its peer
+// disconnects mid-request (removePeer), so every caller gets the timer
+// stopped for free instead of leaking a goroutine that fires onTimeout
+// against whatever request later reuses that index. Callers must hold s.mtx.
+func (s *scheduler) requeueLocked(index uint32) {
+	if req, ok := s.pending[index]; ok {
+		req.timer.Stop()
+		if stats, ok := s.peers[req.peer]; ok && stats.inflight > 0 {
+			stats.inflight--
+		}
+		delete(s.pending, index)
+	}
+
+	s.queue = append([]uint32{index}, s.queue...)
+}
+
+// scoreLocked folds a new throughput sample into peer's EWMA score. A
+// sample of 0 represents a timeout or verification failure and pulls the
+// score toward zero so that repeatedly failing peers stop being picked.
+func (s *scheduler) scoreLocked(peer p2p.PeerID, sample float64) {
+	stats, ok := s.peers[peer]
+	if !ok {
+		return
+	}
+
+	stats.score = scoreAlpha*sample + (1-scoreAlpha)*stats.score
+}
+
+// recordChunkRateLocked folds the interval since the previous completed chunk
+// into the chunks/sec EWMA and reports it as a metric, so that chunks
+// completing in parallel all count towards the rate. The first chunk, with no
+// previous completion, uses its own request latency. Callers must hold s.mtx.
+func (s *scheduler) recordChunkRateLocked(latency time.Duration) {
+	now := time.Now()
+	interval := latency
+	if !s.lastCompletedAt.IsZero() {
+		interval = now.Sub(s.lastCompletedAt)
+	}
+	s.lastCompletedAt = now
+
+	seconds := interval.Seconds()
+	if seconds < 0.001 {
+		seconds = 0.001
+	}
+
+	s.chunksPerSecond = chunksPerSecondAlpha*(1/seconds) + (1-chunksPerSecondAlpha)*s.chunksPerSecond
+	s.metrics.ChunksPerSecond.Set(s.chunksPerSecond)
+}
+
+func (s *scheduler) reportScoresLocked() {
+	for peer, stats := range s.peers {
+		s.metrics.PeerScore.With("peer_id", string(peer)).Set(stats.score)
+	}
+}
+
+// throughputSample converts an observed (size, latency) pair into a score
+// sample in bytes/second, floored to avoid a divide-by-near-zero spike on
+// implausibly fast responses.
+func throughputSample(size int, latency time.Duration) float64 {
+	seconds := latency.Seconds()
+	if seconds < 0.001 {
+		seconds = 0.001
+	}
+	return float64(size) / seconds
+}
+
+// abort stops the scheduler from dispatching any further chunk requests,
+// used once the ABCI app has reported that the snapshot currently being
+// restored can no longer be applied. Any chunk response that arrives late
+// for a request made before abort is dropped by matchesPending, since
+// pending is emptied here.
+func (s *scheduler) abort() {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	for _, req := range s.pending {
+		req.timer.Stop()
+	}
+	s.pending = make(map[uint32]*inflightRequest)
+	s.queue = nil
+}
+
+// remaining reports how many chunks are still outstanding (not yet verified
+// and accepted).
+func (s *scheduler) remaining() int {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	return len(s.queue) + len(s.pending)
+}
@@ -0,0 +1,66 @@
+package statesync
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/tendermint/tendermint/config"
+	"github.com/tendermint/tendermint/libs/log"
+	"github.com/tendermint/tendermint/p2p"
+	ssproto "github.com/tendermint/tendermint/proto/tendermint/statesync"
+)
+
+func TestScheduler_RebalancesOnTimeout(t *testing.T) {
+	cfg := config.DefaultStateSyncConfig()
+	cfg.MaxInflightChunks = 2
+	cfg.ChunkRequestTimeout = 10 * time.Millisecond
+
+	var mtx sync.Mutex
+	sent := map[p2p.PeerID]int{}
+
+	s := newScheduler(log.NewNopLogger(), cfg, NopMetrics(), func(peer p2p.PeerID, req *ssproto.ChunkRequest) {
+		mtx.Lock()
+		sent[peer]++
+		mtx.Unlock()
+	})
+
+	slow := p2p.PeerID("slow")
+	fast := p2p.PeerID("fast")
+	s.addPeer(slow)
+	s.addPeer(fast)
+
+	s.start(1, 1, 1)
+
+	require.Eventually(t, func() bool {
+		mtx.Lock()
+		defer mtx.Unlock()
+		return sent[slow]+sent[fast] >= 2
+	}, time.Second, time.Millisecond, "expected the timed-out chunk to be retried on another peer")
+}
+
+func TestScheduler_OnResponseCompletesChunk(t *testing.T) {
+	cfg := config.DefaultStateSyncConfig()
+	cfg.MaxInflightChunks = 1
+
+	var requested []uint32
+	s := newScheduler(log.NewNopLogger(), cfg, NopMetrics(), func(peer p2p.PeerID, req *ssproto.ChunkRequest) {
+		requested = append(requested, req.Index)
+	})
+
+	peer := p2p.PeerID("only")
+	s.addPeer(peer)
+	s.start(1, 1, 2)
+
+	require.Equal(t, []uint32{0}, requested)
+	require.Equal(t, 2, s.remaining())
+
+	s.onResponse(peer, 0, 3)
+	require.Equal(t, []uint32{0, 1}, requested)
+	require.Equal(t, 1, s.remaining())
+
+	s.onResponse(peer, 1, 3)
+	require.Equal(t, 0, s.remaining())
+}
@@ -0,0 +1,179 @@
+package statesync
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// chunkStore persists verified snapshot chunks to disk, keyed by
+// height/format/index, so that a node interrupted mid-sync can resume
+// from where it left off instead of restarting from chunk 0.
+type chunkStore struct {
+	dir string
+}
+
+// newChunkStore returns a chunkStore rooted at dir, creating it if needed.
+func newChunkStore(dir string) (*chunkStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create chunk store directory %q: %w", dir, err)
+	}
+
+	return &chunkStore{dir: dir}, nil
+}
+
+func (s *chunkStore) snapshotDir(height uint64, format uint32) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%d-%d", height, format))
+}
+
+func (s *chunkStore) chunkPath(height uint64, format uint32, index uint32) string {
+	return filepath.Join(s.snapshotDir(height, format), strconv.FormatUint(uint64(index), 10))
+}
+
+func (s *chunkStore) manifestPath(height uint64, format uint32) string {
+	return filepath.Join(s.snapshotDir(height, format), "manifest.json")
+}
+
+// SaveChunk flushes a verified chunk to disk.
+func (s *chunkStore) SaveChunk(height uint64, format uint32, index uint32, chunk []byte) error {
+	dir := s.snapshotDir(height, format)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	return os.WriteFile(s.chunkPath(height, format, index), chunk, 0o644)
+}
+
+// LoadChunk reads a previously cached chunk, returning (nil, false, nil) if
+// it isn't cached.
+func (s *chunkStore) LoadChunk(height uint64, format uint32, index uint32) ([]byte, bool, error) {
+	chunk, err := os.ReadFile(s.chunkPath(height, format, index))
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+
+	return chunk, true, nil
+}
+
+// CachedIndexes returns the indexes of every chunk already cached on disk
+// for the given snapshot, so the reactor can skip re-requesting them.
+func (s *chunkStore) CachedIndexes(height uint64, format uint32) ([]uint32, error) {
+	entries, err := os.ReadDir(s.snapshotDir(height, format))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	indexes := make([]uint32, 0, len(entries))
+	for _, entry := range entries {
+		index, err := strconv.ParseUint(entry.Name(), 10, 32)
+		if err != nil {
+			continue // skip manifest.json and any other non-chunk files
+		}
+		indexes = append(indexes, uint32(index))
+	}
+
+	return indexes, nil
+}
+
+// chunkStoreManifest is the on-disk record of a snapshot's hash and
+// per-chunk hashes, persisted alongside its cached chunks so a resumed sync
+// can still build Merkle proofs without re-fetching every chunk.
+type chunkStoreManifest struct {
+	SnapshotHash []byte   `json:"snapshot_hash"`
+	ChunkHashes  [][]byte `json:"chunk_hashes"`
+}
+
+// SaveManifest persists the snapshot's hash and chunk hashes.
+func (s *chunkStore) SaveManifest(height uint64, format uint32, snapshotHash []byte, chunkHashes [][]byte) error {
+	dir := s.snapshotDir(height, format)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	bz, err := json.Marshal(chunkStoreManifest{SnapshotHash: snapshotHash, ChunkHashes: chunkHashes})
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(s.manifestPath(height, format), bz, 0o644)
+}
+
+// LoadManifest reads a previously persisted manifest, returning (nil, false,
+// nil) if none was saved for this snapshot.
+func (s *chunkStore) LoadManifest(height uint64, format uint32) (*chunkStoreManifest, bool, error) {
+	bz, err := os.ReadFile(s.manifestPath(height, format))
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+
+	manifest := &chunkStoreManifest{}
+	if err := json.Unmarshal(bz, manifest); err != nil {
+		return nil, false, err
+	}
+
+	return manifest, true, nil
+}
+
+// Discard removes all cached chunks for a snapshot, e.g. because it lost
+// quorum or was superseded by a newer snapshot.
+func (s *chunkStore) Discard(height uint64, format uint32) error {
+	err := os.RemoveAll(s.snapshotDir(height, format))
+	if err != nil {
+		return fmt.Errorf("failed to discard chunk cache for %d/%d: %w", height, format, err)
+	}
+	return nil
+}
+
+// snapshots lists every (height, format) pair currently cached on disk.
+func (s *chunkStore) snapshots() ([]manifestKey, error) {
+	entries, err := os.ReadDir(s.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	keys := make([]manifestKey, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		var height uint64
+		var format uint32
+		if _, err := fmt.Sscanf(entry.Name(), "%d-%d", &height, &format); err != nil {
+			continue
+		}
+		keys = append(keys, manifestKey{height, format})
+	}
+
+	return keys, nil
+}
+
+// PruneStale discards every cached snapshot except keep, freeing disk space
+// held by snapshots that lost quorum or were superseded before the sync
+// that was using them completed.
+func (s *chunkStore) PruneStale(keep manifestKey) error {
+	keys, err := s.snapshots()
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		if key == keep {
+			continue
+		}
+		if err := s.Discard(key.height, key.format); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
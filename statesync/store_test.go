@@ -0,0 +1,68 @@
+package statesync
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestChunkStore_SaveAndResume(t *testing.T) {
+	store, err := newChunkStore(t.TempDir())
+	require.NoError(t, err)
+
+	indexes, err := store.CachedIndexes(1, 1)
+	require.NoError(t, err)
+	require.Empty(t, indexes)
+
+	require.NoError(t, store.SaveChunk(1, 1, 0, []byte{1, 2, 3}))
+	require.NoError(t, store.SaveChunk(1, 1, 2, []byte{4, 5, 6}))
+
+	indexes, err = store.CachedIndexes(1, 1)
+	require.NoError(t, err)
+	require.ElementsMatch(t, []uint32{0, 2}, indexes)
+
+	chunk, ok, err := store.LoadChunk(1, 1, 0)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, []byte{1, 2, 3}, chunk)
+
+	_, ok, err = store.LoadChunk(1, 1, 1)
+	require.NoError(t, err)
+	require.False(t, ok)
+}
+
+func TestChunkStore_Manifest(t *testing.T) {
+	store, err := newChunkStore(t.TempDir())
+	require.NoError(t, err)
+
+	_, ok, err := store.LoadManifest(1, 1)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	hashes := [][]byte{{1}, {2}, {3}}
+	require.NoError(t, store.SaveManifest(1, 1, []byte{0xAB}, hashes))
+
+	manifest, ok, err := store.LoadManifest(1, 1)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, []byte{0xAB}, manifest.SnapshotHash)
+	require.Equal(t, hashes, manifest.ChunkHashes)
+}
+
+func TestChunkStore_PruneStale(t *testing.T) {
+	store, err := newChunkStore(t.TempDir())
+	require.NoError(t, err)
+
+	require.NoError(t, store.SaveChunk(1, 1, 0, []byte{1}))
+	require.NoError(t, store.SaveChunk(2, 1, 0, []byte{2}))
+
+	require.NoError(t, store.PruneStale(manifestKey{height: 2, format: 1}))
+
+	indexes, err := store.CachedIndexes(1, 1)
+	require.NoError(t, err)
+	require.Empty(t, indexes)
+
+	indexes, err = store.CachedIndexes(2, 1)
+	require.NoError(t, err)
+	require.Equal(t, []uint32{0}, indexes)
+}
@@ -0,0 +1,124 @@
+package statesync
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/tendermint/tendermint/p2p"
+)
+
+// trustWindow bounds how long votes for a candidate snapshot are kept
+// around waiting for quorum before they're discarded as stale.
+const trustWindow = 10 * time.Minute
+
+// AppHashVerifier supplies a light-client-verified AppHash for a height, so
+// that a candidate snapshot whose hash disagrees with it can be rejected
+// outright regardless of how many peers voted for it.
+type AppHashVerifier interface {
+	// VerifiedAppHash returns the trusted AppHash for height, and whether
+	// the light client has verified one yet.
+	VerifiedAppHash(height uint64) (hash []byte, ok bool)
+}
+
+type snapshotKey struct {
+	height uint64
+	format uint32
+	hash   string
+}
+
+type snapshotVotes struct {
+	firstSeen time.Time
+	peers     map[p2p.PeerID]bool
+}
+
+// trustTracker corroborates snapshots advertised by peers before they're
+// offered to the ABCI app: a candidate is trusted once either a trusted
+// anchor peer has vouched for it, or a quorum of connected state-sync peers
+// agree on the same (height, format, hash), whichever comes first. A
+// candidate whose hash disagrees with a light-client-verified AppHash at
+// that height is rejected outright.
+type trustTracker struct {
+	trustedPeers map[p2p.PeerID]bool
+	appHashes    AppHashVerifier
+
+	mtx       sync.Mutex
+	votes     map[snapshotKey]*snapshotVotes
+	connected func() int
+}
+
+func newTrustTracker(trustedPeers []p2p.ID, appHashes AppHashVerifier, connected func() int) *trustTracker {
+	trusted := make(map[p2p.PeerID]bool, len(trustedPeers))
+	for _, id := range trustedPeers {
+		trusted[p2p.PeerID(id)] = true
+	}
+
+	return &trustTracker{
+		trustedPeers: trusted,
+		appHashes:    appHashes,
+		votes:        make(map[snapshotKey]*snapshotVotes),
+		connected:    connected,
+	}
+}
+
+// Offer records peer's vote for the (height, format, hash) snapshot and
+// reports whether it is now trusted. An error is returned if the snapshot's
+// hash contradicts a light-client-verified AppHash at that height, in which
+// case it must never be trusted no matter how many peers vote for it.
+func (t *trustTracker) Offer(peer p2p.PeerID, height uint64, format uint32, hash []byte) (bool, error) {
+	if t.appHashes != nil {
+		if verified, ok := t.appHashes.VerifiedAppHash(height); ok && !bytes.Equal(verified, hash) {
+			return false, fmt.Errorf("snapshot hash %X at height %v disagrees with light-client-verified app hash %X", hash, height, verified)
+		}
+	}
+
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	t.pruneLocked()
+
+	key := snapshotKey{height, format, string(hash)}
+	votes, ok := t.votes[key]
+	if !ok {
+		votes = &snapshotVotes{firstSeen: time.Now(), peers: make(map[p2p.PeerID]bool)}
+		t.votes[key] = votes
+	}
+	votes.peers[peer] = true
+
+	if t.trustedPeers[peer] {
+		return true, nil
+	}
+
+	return len(votes.peers) >= t.quorumLocked(), nil
+}
+
+// quorumLocked returns the number of distinct peer votes required to trust a
+// snapshot absent a trusted anchor: two thirds of currently connected
+// state-sync peers, rounded up, with a floor of 1 so a lone peer can still
+// bootstrap a sync.
+func (t *trustTracker) quorumLocked() int {
+	total := 1
+	if t.connected != nil {
+		if n := t.connected(); n > 0 {
+			total = n
+		}
+	}
+
+	quorum := (2*total + 2) / 3 // ceil(2/3 * total)
+	if quorum < 1 {
+		quorum = 1
+	}
+	return quorum
+}
+
+// pruneLocked discards votes for candidates that have been waiting longer
+// than trustWindow without reaching quorum. Callers must hold t.mtx.
+func (t *trustTracker) pruneLocked() {
+	cutoff := time.Now().Add(-trustWindow)
+	for key, votes := range t.votes {
+		if votes.firstSeen.Before(cutoff) {
+			delete(t.votes, key)
+		}
+	}
+}
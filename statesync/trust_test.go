@@ -0,0 +1,60 @@
+package statesync
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/tendermint/tendermint/p2p"
+)
+
+type fixedAppHash struct {
+	height uint64
+	hash   []byte
+}
+
+func (f fixedAppHash) VerifiedAppHash(height uint64) ([]byte, bool) {
+	if height != f.height {
+		return nil, false
+	}
+	return f.hash, true
+}
+
+func TestTrustTracker_QuorumAmongConnectedPeers(t *testing.T) {
+	connected := 4 // quorum = ceil(2/3 * 4) = 3
+	tracker := newTrustTracker(nil, nil, func() int { return connected })
+
+	hash := []byte{1, 2, 3}
+
+	trusted, err := tracker.Offer(p2p.PeerID("a"), 100, 1, hash)
+	require.NoError(t, err)
+	require.False(t, trusted)
+
+	trusted, err = tracker.Offer(p2p.PeerID("b"), 100, 1, hash)
+	require.NoError(t, err)
+	require.False(t, trusted)
+
+	trusted, err = tracker.Offer(p2p.PeerID("c"), 100, 1, hash)
+	require.NoError(t, err)
+	require.True(t, trusted, "expected quorum once a third distinct peer corroborated the snapshot")
+
+	// A duplicate vote from an already-counted peer must not matter.
+	trusted, err = tracker.Offer(p2p.PeerID("a"), 100, 1, hash)
+	require.NoError(t, err)
+	require.True(t, trusted)
+}
+
+func TestTrustTracker_TrustedAnchorBypassesQuorum(t *testing.T) {
+	tracker := newTrustTracker([]p2p.ID{"anchor"}, nil, func() int { return 100 })
+
+	trusted, err := tracker.Offer(p2p.PeerID("anchor"), 100, 1, []byte{1, 2, 3})
+	require.NoError(t, err)
+	require.True(t, trusted, "a single trusted anchor should be enough regardless of peer quorum")
+}
+
+func TestTrustTracker_RejectsAppHashMismatch(t *testing.T) {
+	tracker := newTrustTracker([]p2p.ID{"anchor"}, fixedAppHash{height: 100, hash: []byte{9, 9, 9}}, func() int { return 1 })
+
+	_, err := tracker.Offer(p2p.PeerID("anchor"), 100, 1, []byte{1, 2, 3})
+	require.Error(t, err, "a snapshot hash disagreeing with the verified app hash must be rejected even from a trusted peer")
+}